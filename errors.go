@@ -0,0 +1,106 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ErrorLinks is the "links" member of a JSON:API error object.
+type ErrorLinks struct {
+	About string `json:"about,omitempty"`
+}
+
+// ErrorSource is the "source" member of a JSON:API error object, pointing
+// at the part of the request document that caused the error.
+type ErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// ErrorObject is a JSON:API error object as described at
+// http://jsonapi.org/format/#error-objects.
+type ErrorObject struct {
+	Id     string                 `json:"id,omitempty"`
+	Links  *ErrorLinks            `json:"links,omitempty"`
+	Status string                 `json:"status,omitempty"`
+	Code   string                 `json:"code,omitempty"`
+	Title  string                 `json:"title,omitempty"`
+	Detail string                 `json:"detail,omitempty"`
+	Source *ErrorSource           `json:"source,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// Error implements the error interface so an *ErrorObject can be returned
+// and handled anywhere a plain Go error is expected.
+func (e *ErrorObject) Error() string {
+	return fmt.Sprintf("Error: %s %s", e.Title, e.Detail)
+}
+
+// ErrorsPayload is the top-level document for a JSON:API error response, as
+// described at http://jsonapi.org/format/#error-objects.
+type ErrorsPayload struct {
+	Errors []*ErrorObject         `json:"errors"`
+	Links  map[string]string      `json:"links,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// ErrorObjecter lets a Go error carry its own JSON:API error representation
+// so handler code can return a rich API error directly instead of
+// hand-rolling an ErrorObject at the call site.
+type ErrorObjecter interface {
+	error
+	ErrorObject() *ErrorObject
+}
+
+// MarshalErrors writes a JSON:API error document for errs.
+func MarshalErrors(w io.Writer, errs []*ErrorObject) error {
+	return json.NewEncoder(w).Encode(&ErrorsPayload{Errors: errs})
+}
+
+// MarshalErrorsWithExtras is identical to MarshalErrors but also applies
+// top-level links and meta supplied via the extras callback, the same way
+// MarshalOnePayloadWithExtras does for success payloads.
+func MarshalErrorsWithExtras(w io.Writer, errs []*ErrorObject, extrasFn func(*ApiExtras)) error {
+	extras := newApiExtras()
+	if extrasFn != nil {
+		extrasFn(extras)
+	}
+
+	payload := &ErrorsPayload{Errors: errs}
+	if len(extras.rootLinks) > 0 {
+		payload.Links = extras.rootLinks
+	}
+	if len(extras.rootMeta) > 0 {
+		payload.Meta = extras.rootMeta
+	}
+
+	return json.NewEncoder(w).Encode(payload)
+}
+
+// ErrorObjectFromError converts err into an *ErrorObject, using err's own
+// ErrorObject() representation when it implements ErrorObjecter, and
+// falling back to a generic 500 with err.Error() as the detail otherwise.
+func ErrorObjectFromError(err error) *ErrorObject {
+	if oe, ok := err.(ErrorObjecter); ok {
+		return oe.ErrorObject()
+	}
+
+	return &ErrorObject{
+		Status: "500",
+		Title:  "Internal Server Error",
+		Detail: err.Error(),
+	}
+}
+
+// MarshalErrorsFromErrors writes a JSON:API error document built from a
+// slice of Go errors, converting each via ErrorObjectFromError so handler
+// code can mix plain errors with ErrorObjecter-implementing ones.
+func MarshalErrorsFromErrors(w io.Writer, errs []error) error {
+	objs := make([]*ErrorObject, len(errs))
+	for i, err := range errs {
+		objs[i] = ErrorObjectFromError(err)
+	}
+
+	return MarshalErrors(w, objs)
+}
@@ -0,0 +1,133 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type validationError struct {
+	field string
+}
+
+func (e *validationError) Error() string {
+	return "invalid " + e.field
+}
+
+func (e *validationError) ErrorObject() *ErrorObject {
+	return &ErrorObject{
+		Status: "422",
+		Title:  "Validation Failure",
+		Detail: "invalid " + e.field,
+		Source: &ErrorSource{Pointer: "/data/attributes/" + e.field},
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+
+	errs := []*ErrorObject{
+		{
+			Status: "400",
+			Title:  "Bad Request",
+			Detail: "title is required",
+			Source: &ErrorSource{Pointer: "/data/attributes/title"},
+		},
+	}
+
+	if err := MarshalErrors(buf, errs); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(ErrorsPayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(payload.Errors) != 1 {
+		t.Fatalf("expected one error, got %d", len(payload.Errors))
+	}
+
+	if payload.Errors[0].Status != "400" {
+		t.Fatalf("status not serialized")
+	}
+
+	if payload.Errors[0].Source == nil || payload.Errors[0].Source.Pointer != "/data/attributes/title" {
+		t.Fatalf("source pointer not serialized")
+	}
+}
+
+func TestMarshalErrorsWithExtras(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+
+	errs := []*ErrorObject{{Status: "500", Title: "Internal Server Error"}}
+
+	err := MarshalErrorsWithExtras(buf, errs, func(c *ApiExtras) {
+		c.AddRootLink("self", "https://localhost:8080/api/v1/errors")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(ErrorsPayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Links["self"] != "https://localhost:8080/api/v1/errors" {
+		t.Fatalf("root link not applied to error document")
+	}
+}
+
+func TestErrorObjectFromError(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+
+	errs := []error{
+		&validationError{field: "title"},
+		errors.New("boom"),
+	}
+
+	if err := MarshalErrorsFromErrors(buf, errs); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(ErrorsPayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(payload.Errors) != 2 {
+		t.Fatalf("expected two errors, got %d", len(payload.Errors))
+	}
+
+	if payload.Errors[0].Status != "422" {
+		t.Fatalf("did not use ErrorObjecter representation")
+	}
+
+	if payload.Errors[1].Status != "500" {
+		t.Fatalf("did not fall back to a generic 500 for a plain error")
+	}
+}
+
+func TestMarshalErrorsWithExtrasMeta(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+
+	errs := []*ErrorObject{{Status: "429", Title: "Too Many Requests"}}
+
+	err := MarshalErrorsWithExtras(buf, errs, func(c *ApiExtras) {
+		c.AddMeta("retry-after", 30)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(ErrorsPayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Meta["retry-after"] != float64(30) {
+		t.Fatalf("expected retry-after meta on error document, got %#v", payload.Meta["retry-after"])
+	}
+}
@@ -0,0 +1,239 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSelectFieldsSuppressesUnlistedAttributes(t *testing.T) {
+	testModel := testBlog()
+	buf := bytes.NewBuffer(nil)
+
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.SelectFields("blogs", "title", "posts", "current_post")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := payload.Data.Attributes
+	if attrs["title"] != "Title 1" {
+		t.Fatalf("expected title to survive field selection, got %#v", attrs)
+	}
+	if _, ok := attrs["view_count"]; ok {
+		t.Fatalf("expected view_count to be suppressed, got %#v", attrs)
+	}
+	if _, ok := attrs["created_at"]; ok {
+		t.Fatalf("expected created_at to be suppressed, got %#v", attrs)
+	}
+
+	if payload.Data.Relationships["posts"] == nil {
+		t.Fatalf("expected posts relationship to survive field selection")
+	}
+}
+
+func TestSelectFieldsAppliesRegardlessOfFieldOrder(t *testing.T) {
+	// ReorderedBlog declares its relation field ahead of its primary
+	// field. node.Type must still be known by the time fieldAllowed runs,
+	// so field selection must filter it the same as it would for Blog.
+	testModel := &ReorderedBlog{
+		Id:    1,
+		Title: "Title 1",
+		Posts: []*Post{{Id: 1, Title: "Post 1"}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.SelectFields("blogs", "title")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Data.Attributes["title"] != "Title 1" {
+		t.Fatalf("expected title to survive field selection, got %#v", payload.Data.Attributes)
+	}
+
+	if _, ok := payload.Data.Relationships["posts"]; ok {
+		t.Fatalf("expected posts relationship to be suppressed, got %#v", payload.Data.Relationships)
+	}
+}
+
+func TestSelectFieldsSuppressesUnlistedRelationships(t *testing.T) {
+	testModel := testBlog()
+	buf := bytes.NewBuffer(nil)
+
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.SelectFields("blogs", "title")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Data.Relationships["posts"] != nil {
+		t.Fatalf("expected posts relationship to be suppressed, got %#v", payload.Data.Relationships)
+	}
+	if payload.Included != nil {
+		t.Fatalf("expected no included resources once their relationship is suppressed")
+	}
+}
+
+func TestIncludeFiltersIncludedResources(t *testing.T) {
+	testModel := testBlog()
+	buf := bytes.NewBuffer(nil)
+
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.Include("current_post")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Data.Relationships["posts"] == nil {
+		t.Fatalf("relationship linkage should survive even when not included")
+	}
+
+	if len(payload.Included) != 1 {
+		t.Fatalf("expected only current_post to be sideloaded, got %d included resources", len(payload.Included))
+	}
+
+	only := payload.Included[0]
+	if only.Type != "posts" || only.Id != "1" {
+		t.Fatalf("expected current_post (posts#1) to be included, got %s#%s", only.Type, only.Id)
+	}
+
+	for _, n := range payload.Included {
+		if n.Type == "comments" {
+			t.Fatalf("did not expect comments to be included without posts.comments or current_post.comments")
+		}
+	}
+}
+
+func TestIncludeTransitiveClosure(t *testing.T) {
+	testModel := testBlog()
+	buf := bytes.NewBuffer(nil)
+
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.Include("posts.comments")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	seenTypes := map[string]int{}
+	for _, n := range payload.Included {
+		seenTypes[n.Type]++
+	}
+
+	if seenTypes["posts"] != 2 {
+		t.Fatalf("expected both posts to be included, got %d", seenTypes["posts"])
+	}
+	if seenTypes["comments"] == 0 {
+		t.Fatalf("expected comments to be included via the posts.comments closure")
+	}
+}
+
+func TestAddMeta(t *testing.T) {
+	testModel := testBlog()
+	buf := bytes.NewBuffer(nil)
+
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.AddMeta("request-id", "abc-123")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Meta["request-id"] != "abc-123" {
+		t.Fatalf("expected top-level meta to be set, got %#v", payload.Meta)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	testModel := testBlog()
+	buf := bytes.NewBuffer(nil)
+
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.Paginate(
+			linkTemplateBlogs+"?page=2",
+			linkTemplateBlogs+"?page=1",
+			linkTemplateBlogs+"?page=1",
+			linkTemplateBlogs+"?page=3",
+			linkTemplateBlogs+"?page=10",
+			10, 100,
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"self", "first", "prev", "next", "last"} {
+		if payload.Links[name] == "" {
+			t.Fatalf("expected pagination link %q to be set", name)
+		}
+	}
+
+	if payload.Meta["total-pages"] != float64(10) {
+		t.Fatalf("expected total-pages meta, got %#v", payload.Meta["total-pages"])
+	}
+	if payload.Meta["total-count"] != float64(100) {
+		t.Fatalf("expected total-count meta, got %#v", payload.Meta["total-count"])
+	}
+}
+
+func TestPaginateOmitsEmptyLinks(t *testing.T) {
+	testModel := testBlog()
+	buf := bytes.NewBuffer(nil)
+
+	err := MarshalOnePayloadWithExtras(buf, testModel, func(c *ApiExtras) {
+		c.Paginate(linkTemplateBlogs+"?page=1", linkTemplateBlogs+"?page=1", "", linkTemplateBlogs+"?page=2", linkTemplateBlogs+"?page=10", 10, 100)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := payload.Links["prev"]; ok {
+		t.Fatalf("expected prev link to be omitted on the first page")
+	}
+}
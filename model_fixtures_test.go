@@ -0,0 +1,26 @@
+package jsonapi
+
+// BadModel carries a malformed jsonapi tag (missing the required type
+// argument) so tests can exercise the tag-validation error path.
+type BadModel struct {
+	Id int `jsonapi:"primary"`
+}
+
+// ReorderedBlog carries a subset of Blog's fields (posts, title and the
+// blogs primary), but declares its relation and attr fields ahead of its
+// primary field, which Go allows
+// and no repo convention forbids. It exists to prove node.Type is
+// resolved independent of field order.
+type ReorderedBlog struct {
+	Posts []*Post `jsonapi:"relation,posts"`
+	Title string  `jsonapi:"attr,title"`
+	Id    int     `jsonapi:"primary,blogs"`
+}
+
+// BadLinksModel declares a links field typed as a string instead of a
+// map, so tests can exercise the kind-mismatch error path in
+// setLinksField.
+type BadLinksModel struct {
+	Id    int    `jsonapi:"primary,bad_links_models"`
+	Links string `jsonapi:"links,top"`
+}
@@ -0,0 +1,178 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// ActivityEvent has no primary jsonapi tag of its own; it implements
+// Referencer so the same Go type can surface as different jsonapi types
+// depending on Kind, the way a heterogeneous activity feed would.
+type ActivityEvent struct {
+	Kind    string
+	EventID int
+	Title   string `jsonapi:"attr,title"`
+}
+
+func (a *ActivityEvent) JSONAPIType() string { return a.Kind }
+func (a *ActivityEvent) JSONAPIID() string   { return strconv.Itoa(a.EventID) }
+
+type Feed struct {
+	Id    int           `jsonapi:"primary,feeds"`
+	Items []interface{} `jsonapi:"relation,items"`
+}
+
+func TestMarshalPolymorphicRelation(t *testing.T) {
+	feed := &Feed{
+		Id: 1,
+		Items: []interface{}{
+			&ActivityEvent{Kind: "posts", EventID: 1, Title: "Hello"},
+			&ActivityEvent{Kind: "comments", EventID: 2, Title: "World"},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := MarshalOnePayload(buf, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	items := resp.Data.Relationships["items"].(map[string]interface{})["data"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("expected two items, got %d", len(items))
+	}
+
+	first := items[0].(map[string]interface{})
+	if first["type"] != "posts" || first["id"] != "1" {
+		t.Fatalf("first item did not use Referencer type/id: %#v", first)
+	}
+
+	second := items[1].(map[string]interface{})
+	if second["type"] != "comments" || second["id"] != "2" {
+		t.Fatalf("second item did not use Referencer type/id: %#v", second)
+	}
+
+	if len(resp.Included) != 2 {
+		t.Fatalf("expected two included resources, got %d", len(resp.Included))
+	}
+
+	seen := map[string]bool{}
+	for _, n := range resp.Included {
+		seen[n.Type+"#"+n.Id] = true
+		if n.Type == "posts" && n.Attributes["title"] != "Hello" {
+			t.Fatalf("included posts resource missing attributes: %#v", n)
+		}
+	}
+	if !seen["posts#1"] || !seen["comments#2"] {
+		t.Fatalf("included resources not keyed by (type, id): %#v", seen)
+	}
+}
+
+func TestMarshalStaticRelationStillWorks(t *testing.T) {
+	// Backward-compatibility check: Blog.Posts keeps using the primary
+	// tag on *Post, unaffected by Referencer support.
+	testModel := testBlog()
+
+	buf := bytes.NewBuffer(nil)
+	if err := MarshalOnePayload(buf, testModel); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := resp.Data.Relationships["posts"].(map[string]interface{})["data"].([]interface{})
+	for _, p := range posts {
+		ref := p.(map[string]interface{})
+		if ref["type"] != "posts" {
+			t.Fatalf("expected type posts, got %v", ref["type"])
+		}
+	}
+}
+
+func TestUnmarshalPolymorphicRelationReturnsError(t *testing.T) {
+	// There is no way to recover ActivityEvent from a jsonapi type name
+	// alone, so UnmarshalPayload must error out cleanly on an
+	// interface{}-typed relation field instead of panicking inside
+	// reflect.
+	feed := &Feed{
+		Id: 1,
+		Items: []interface{}{
+			&ActivityEvent{Kind: "posts", EventID: 1, Title: "Hello"},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := MarshalOnePayload(buf, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Feed)
+	err := UnmarshalPayload(buf, got)
+	if err == nil {
+		t.Fatalf("expected an error unmarshaling a polymorphic relation field, got nil")
+	}
+}
+
+func TestSelectFieldsAppliesToReferencerType(t *testing.T) {
+	feed := &Feed{
+		Id: 1,
+		Items: []interface{}{
+			&ActivityEvent{Kind: "posts", EventID: 1, Title: "Hello"},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := MarshalOnePayloadWithExtras(buf, feed, func(c *ApiExtras) {
+		c.SelectFields("posts")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Included) != 1 {
+		t.Fatalf("expected one included resource, got %d", len(resp.Included))
+	}
+
+	if _, ok := resp.Included[0].Attributes["title"]; ok {
+		t.Fatalf("expected SelectFields(\"posts\") to suppress title on a Referencer-typed node, got %#v", resp.Included[0].Attributes)
+	}
+}
+
+func TestMarshalPolymorphicRelationSkipsNilElement(t *testing.T) {
+	// A nil element of a []interface{} relation reports Kind() ==
+	// Interface, not Ptr, so it must be filtered the same way a nil *T
+	// element already is.
+	feed := &Feed{
+		Id:    1,
+		Items: []interface{}{nil},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := MarshalOnePayload(buf, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := new(OnePayload)
+	if err := json.NewDecoder(buf).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	items := resp.Data.Relationships["items"].(map[string]interface{})["data"].([]interface{})
+	if len(items) != 0 {
+		t.Fatalf("expected nil element to be skipped, got %#v", items)
+	}
+}
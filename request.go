@@ -0,0 +1,317 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnmarshalPayload reads a JSON:API document from r and populates model's
+// jsonapi-tagged fields from its "data" member. Relation fields are
+// resolved against the document's "included" array by (type, id); this is
+// the inverse of MarshalOnePayload.
+func UnmarshalPayload(r io.Reader, model interface{}) error {
+	payload := new(OnePayload)
+	if err := json.NewDecoder(r).Decode(payload); err != nil {
+		return err
+	}
+
+	if payload.Data == nil {
+		return errors.New("jsonapi: payload has no data")
+	}
+
+	included := indexIncluded(payload.Included)
+
+	return unmarshalNode(payload.Data, reflect.ValueOf(model), included)
+}
+
+// UnmarshalManyPayload reads a JSON:API document whose "data" member is an
+// array, returning one populated value of type t for each element. t must
+// be a pointer type, e.g. reflect.TypeOf(new(Blog)).
+func UnmarshalManyPayload(r io.Reader, t reflect.Type) ([]interface{}, error) {
+	payload := new(ManyPayload)
+	if err := json.NewDecoder(r).Decode(payload); err != nil {
+		return nil, err
+	}
+
+	included := indexIncluded(payload.Included)
+
+	models := make([]interface{}, 0, len(payload.Data))
+	for _, node := range payload.Data {
+		model := reflect.New(t.Elem())
+		if err := unmarshalNode(node, model, included); err != nil {
+			return nil, err
+		}
+		models = append(models, model.Interface())
+	}
+
+	return models, nil
+}
+
+func indexIncluded(included []*Node) map[string]*Node {
+	index := make(map[string]*Node, len(included))
+	for _, node := range included {
+		index[node.Type+"#"+node.Id] = node
+	}
+	return index
+}
+
+func unmarshalNode(node *Node, model reflect.Value, included map[string]*Node) error {
+	if model.Kind() == reflect.Ptr {
+		model = model.Elem()
+	}
+	modelType := model.Type()
+
+	for i := 0; i < modelType.NumField(); i++ {
+		structField := modelType.Field(i)
+		tag := structField.Tag.Get("jsonapi")
+		if tag == "" {
+			continue
+		}
+
+		fieldValue := model.Field(i)
+		args := strings.Split(tag, ",")
+		annotation := args[0]
+
+		switch annotation {
+		case annotationPrimary:
+			if len(args) < 2 {
+				return errors.New("jsonapi: primary tag, got two few arguments")
+			}
+
+			if node.Type != args[1] {
+				return fmt.Errorf("jsonapi: expected type %q, got %q", args[1], node.Type)
+			}
+
+			if err := setIdField(fieldValue, node.Id); err != nil {
+				return err
+			}
+
+		case annotationAttr:
+			if len(args) < 2 {
+				return errors.New("jsonapi: attr tag, got two few arguments")
+			}
+
+			data, ok := node.Attributes[args[1]]
+			if !ok || data == nil {
+				continue
+			}
+
+			if err := setAttrField(fieldValue, data); err != nil {
+				return err
+			}
+
+		case annotationRelation:
+			if len(args) < 2 {
+				return errors.New("jsonapi: relation tag, got two few arguments")
+			}
+
+			if err := setRelationField(fieldValue, node.Relationships[args[1]], included); err != nil {
+				return err
+			}
+
+		case annotationLinks:
+			if len(args) < 2 {
+				return errors.New("jsonapi: links tag, got two few arguments")
+			}
+
+			if err := setLinksField(fieldValue, node, args[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func setIdField(fieldValue reflect.Value, id string) error {
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(id)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("jsonapi: id %q is not a valid integer: %s", id, err)
+		}
+		fieldValue.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("jsonapi: id %q is not a valid integer: %s", id, err)
+		}
+		fieldValue.SetUint(n)
+	default:
+		return errors.New("jsonapi: primary field must be a string or integer type")
+	}
+
+	return nil
+}
+
+func setAttrField(fieldValue reflect.Value, data interface{}) error {
+	if _, ok := fieldValue.Interface().(time.Time); ok {
+		str, ok := data.(string)
+		if !ok {
+			return errors.New("jsonapi: time attribute was not a string")
+		}
+
+		t, err := time.Parse(time.RFC3339, str)
+		if err != nil {
+			return fmt.Errorf("jsonapi: could not parse time attribute: %s", err)
+		}
+
+		fieldValue.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.String:
+		str, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("jsonapi: expected string attribute, got %T", data)
+		}
+		fieldValue.SetString(str)
+
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return fmt.Errorf("jsonapi: expected bool attribute, got %T", data)
+		}
+		fieldValue.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := data.(float64)
+		if !ok {
+			return fmt.Errorf("jsonapi: expected numeric attribute, got %T", data)
+		}
+		fieldValue.SetInt(int64(n))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := data.(float64)
+		if !ok {
+			return fmt.Errorf("jsonapi: expected numeric attribute, got %T", data)
+		}
+		fieldValue.SetUint(uint64(n))
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := data.(float64)
+		if !ok {
+			return fmt.Errorf("jsonapi: expected numeric attribute, got %T", data)
+		}
+		fieldValue.SetFloat(n)
+
+	default:
+		return fmt.Errorf("jsonapi: unsupported attribute field type %s", fieldValue.Type())
+	}
+
+	return nil
+}
+
+func setRelationField(fieldValue reflect.Value, relationship interface{}, included map[string]*Node) error {
+	if relationship == nil {
+		return nil
+	}
+
+	relMap, ok := relationship.(map[string]interface{})
+	if !ok {
+		return errors.New("jsonapi: malformed relationship object")
+	}
+
+	data, ok := relMap["data"]
+	if !ok || data == nil {
+		return nil
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.Slice:
+		refs, ok := data.([]interface{})
+		if !ok {
+			return errors.New("jsonapi: expected a to-many relationship")
+		}
+
+		elemType := fieldValue.Type().Elem()
+		if elemType.Kind() != reflect.Ptr {
+			return fmt.Errorf("jsonapi: cannot unmarshal relation into %s; polymorphic relation fields (marshaled via Referencer) are not resolvable back to a concrete Go type", fieldValue.Type())
+		}
+
+		slice := reflect.MakeSlice(fieldValue.Type(), 0, len(refs))
+
+		for _, ref := range refs {
+			related, err := resolveRelated(ref, elemType, included)
+			if err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, related)
+		}
+
+		fieldValue.Set(slice)
+
+	case reflect.Ptr:
+		related, err := resolveRelated(data, fieldValue.Type(), included)
+		if err != nil {
+			return err
+		}
+		fieldValue.Set(related)
+
+	default:
+		return fmt.Errorf("jsonapi: cannot unmarshal relation into %s; polymorphic relation fields (marshaled via Referencer) are not resolvable back to a concrete Go type", fieldValue.Type())
+	}
+
+	return nil
+}
+
+func resolveRelated(ref interface{}, elemType reflect.Type, included map[string]*Node) (reflect.Value, error) {
+	refMap, ok := ref.(map[string]interface{})
+	if !ok {
+		return reflect.Value{}, errors.New("jsonapi: malformed relationship reference")
+	}
+
+	refType, _ := refMap["type"].(string)
+	refId, _ := refMap["id"].(string)
+
+	node, ok := included[refType+"#"+refId]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("jsonapi: no included resource for %s#%s", refType, refId)
+	}
+
+	model := reflect.New(elemType.Elem())
+	if err := unmarshalNode(node, model, included); err != nil {
+		return reflect.Value{}, err
+	}
+
+	return model, nil
+}
+
+func setLinksField(fieldValue reflect.Value, node *Node, name string) error {
+	var links map[string]interface{}
+
+	if name == annotationTopLinks {
+		links = node.Links
+	} else if rel, ok := node.Relationships[name].(map[string]interface{}); ok {
+		links, _ = rel["links"].(map[string]interface{})
+	}
+
+	if len(links) == 0 {
+		return nil
+	}
+
+	if fieldValue.Kind() != reflect.Map {
+		return fmt.Errorf("jsonapi: links field must be a map, got %s", fieldValue.Type())
+	}
+
+	out := reflect.MakeMapWithSize(fieldValue.Type(), len(links))
+	for key, value := range links {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		out.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(str))
+	}
+
+	fieldValue.Set(out)
+	return nil
+}
@@ -0,0 +1,115 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalPayloadRoundTrip(t *testing.T) {
+	original := testBlog()
+
+	buf := bytes.NewBuffer(nil)
+	if err := MarshalOnePayload(buf, original); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Blog)
+	if err := UnmarshalPayload(buf, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Id != original.Id {
+		t.Fatalf("expected id %d, got %d", original.Id, got.Id)
+	}
+
+	if got.Title != original.Title {
+		t.Fatalf("expected title %q, got %q", original.Title, got.Title)
+	}
+
+	if !got.CreatedAt.Equal(original.CreatedAt) {
+		t.Fatalf("created_at did not round-trip: got %v, want %v", got.CreatedAt, original.CreatedAt)
+	}
+
+	if len(got.Posts) != len(original.Posts) {
+		t.Fatalf("expected %d posts, got %d", len(original.Posts), len(got.Posts))
+	}
+
+	for i, post := range got.Posts {
+		if post.Id != original.Posts[i].Id || post.Title != original.Posts[i].Title {
+			t.Fatalf("post %d did not round-trip: %+v", i, post)
+		}
+		if len(post.Comments) != len(original.Posts[i].Comments) {
+			t.Fatalf("post %d expected %d comments, got %d", i, len(original.Posts[i].Comments), len(post.Comments))
+		}
+		for j, comment := range post.Comments {
+			if comment.Id != original.Posts[i].Comments[j].Id || comment.Body != original.Posts[i].Comments[j].Body {
+				t.Fatalf("comment %d on post %d did not round-trip: %+v", j, i, comment)
+			}
+		}
+		if post.LatestComment == nil || post.LatestComment.Id != original.Posts[i].LatestComment.Id {
+			t.Fatalf("post %d latest_comment did not round-trip", i)
+		}
+	}
+
+	if got.CurrentPost == nil || got.CurrentPost.Id != original.CurrentPost.Id {
+		t.Fatalf("current_post did not round-trip")
+	}
+}
+
+func TestUnmarshalManyPayload(t *testing.T) {
+	original := []interface{}{
+		&Blog{Id: 5, Title: "Title 1"},
+		&Blog{Id: 6, Title: "Title 2"},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := MarshalManyPayload(buf, original); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := UnmarshalManyPayload(buf, reflect.TypeOf(new(Blog)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("expected 2 models, got %d", len(models))
+	}
+
+	for i, model := range models {
+		blog, ok := model.(*Blog)
+		if !ok {
+			t.Fatalf("model %d was not a *Blog", i)
+		}
+		want := original[i].(*Blog)
+		if blog.Id != want.Id || blog.Title != want.Title {
+			t.Fatalf("model %d did not round-trip: %+v", i, blog)
+		}
+	}
+}
+
+func TestUnmarshalLinksFieldKindMismatchReturnsError(t *testing.T) {
+	// A links field typed as anything other than a map must error out
+	// cleanly instead of panicking inside reflect.MakeMapWithSize, the
+	// same way every other unmarshal helper in request.go rejects a
+	// field-kind mismatch.
+	payload := &OnePayload{
+		Data: &Node{
+			Type:  "bad_links_models",
+			Id:    "1",
+			Links: map[string]interface{}{"self": "https://localhost:8080/api/v1/bad_links_models/1"},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(buf).Encode(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(BadLinksModel)
+	if err := UnmarshalPayload(buf, got); err == nil {
+		t.Fatalf("expected an error unmarshaling links into a non-map field, got nil")
+	}
+}
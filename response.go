@@ -0,0 +1,601 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	annotationPrimary  = "primary"
+	annotationAttr     = "attr"
+	annotationRelation = "relation"
+	annotationLinks    = "links"
+
+	annotationTopLinks = "top"
+)
+
+// OnePayload is used to represent a generic JSON:API payload where a single
+// resource was included as data. Although this was originally designed to
+// be the response structure for /resource/:id GETs, it is also the payload
+// structure for POST/PATCH requests that exchange a single resource.
+type OnePayload struct {
+	Data     *Node                  `json:"data"`
+	Included []*Node                `json:"included,omitempty"`
+	Links    map[string]string      `json:"links,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+// ManyPayload is used to represent a generic JSON:API payload where many
+// resources were included as data. This is the response structure for
+// /resources GETs.
+type ManyPayload struct {
+	Data     []*Node                `json:"data"`
+	Included []*Node                `json:"included,omitempty"`
+	Links    map[string]string      `json:"links,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+// Node is a JSON:API resource object as described at
+// http://jsonapi.org/format/#document-resource-objects.
+type Node struct {
+	Type          string                 `json:"type"`
+	Id            string                 `json:"id"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Relationships map[string]interface{} `json:"relationships,omitempty"`
+	Links         map[string]interface{} `json:"links,omitempty"`
+}
+
+// ApiExtras carries the top-level links, per-relationship links, sparse
+// fieldset selections and include-path filters that
+// MarshalOnePayloadWithExtras applies while a payload is built from a
+// model's jsonapi struct tags.
+type ApiExtras struct {
+	rootLinks         map[string]string
+	rootMeta          map[string]interface{}
+	relationshipLinks []relationshipLinkExtra
+	fieldSelections   map[string]map[string]bool
+	includePaths      map[string]bool
+	filterIncludes    bool
+}
+
+type relationshipLinkExtra struct {
+	pageName     string
+	relationName string
+	relatedType  string
+	ownerType    string
+	url          string
+}
+
+func newApiExtras() *ApiExtras {
+	return &ApiExtras{rootLinks: map[string]string{}}
+}
+
+// AddRootLink registers a top-level "links" member entry, e.g. "self" or
+// "next" for pagination.
+func (e *ApiExtras) AddRootLink(name, url string) {
+	e.rootLinks[name] = url
+}
+
+// AddRelationshipLink registers a "links" entry that will be nested under
+// relationships[relationName]["links"] for every node of type ownerType in
+// data or included that already has a relationName relationship; nodes
+// without that relationship get no link.
+// relatedType is the jsonapi type of the resource(s) the relationship
+// points at. url may reference the owning node's id with a "{ownerType.id}"
+// style placeholder, e.g. "{blogs.id}".
+func (e *ApiExtras) AddRelationshipLink(pageName, relationName, relatedType, ownerType, url string) {
+	e.relationshipLinks = append(e.relationshipLinks, relationshipLinkExtra{
+		pageName:     pageName,
+		relationName: relationName,
+		relatedType:  relatedType,
+		ownerType:    ownerType,
+		url:          url,
+	})
+}
+
+// AddMeta registers a top-level "meta" member entry.
+func (e *ApiExtras) AddMeta(key string, value interface{}) {
+	if e.rootMeta == nil {
+		e.rootMeta = map[string]interface{}{}
+	}
+	e.rootMeta[key] = value
+}
+
+// Paginate fills the standard pagination links (self, first, prev, next,
+// last) and a meta.total-pages / meta.total-count pair, so list endpoints
+// don't have to build these by hand. Pass an empty string for a link that
+// doesn't apply, e.g. prev on the first page; it is omitted rather than
+// serialized empty.
+func (e *ApiExtras) Paginate(self, first, prev, next, last string, totalPages, totalCount int) {
+	for name, link := range map[string]string{
+		"self": self, "first": first, "prev": prev, "next": next, "last": last,
+	} {
+		if link != "" {
+			e.AddRootLink(name, link)
+		}
+	}
+
+	e.AddMeta("total-pages", totalPages)
+	e.AddMeta("total-count", totalCount)
+}
+
+// SelectFields restricts the attributes and relationships serialized for
+// every node of the given jsonapi type to fields, mirroring the
+// fields[type]=... query parameter. Attr- and relation-tagged fields for
+// typeName that are not listed are omitted from the resource object.
+// Types that never appear in a SelectFields call are serialized in full.
+func (e *ApiExtras) SelectFields(typeName string, fields ...string) {
+	if e.fieldSelections == nil {
+		e.fieldSelections = map[string]map[string]bool{}
+	}
+
+	set := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		set[field] = true
+	}
+	e.fieldSelections[typeName] = set
+}
+
+// Include restricts which related resources are sideloaded into the
+// top-level "included" array, mirroring the include=... query parameter.
+// paths are dot-separated, e.g. "posts.comments"; requesting a path also
+// includes every one of its ancestors (requesting "posts.comments" also
+// includes "posts"). Relationship linkage in "relationships" is unaffected
+// by Include -- it only controls what gets a full resource object under
+// "included". Calling Include at all switches the payload from "include
+// everything" to "include only what was asked for".
+func (e *ApiExtras) Include(paths ...string) {
+	e.filterIncludes = true
+
+	if e.includePaths == nil {
+		e.includePaths = map[string]bool{}
+	}
+
+	for _, path := range paths {
+		segments := strings.Split(path, ".")
+		for i := range segments {
+			e.includePaths[strings.Join(segments[:i+1], ".")] = true
+		}
+	}
+}
+
+func (e *ApiExtras) fieldAllowed(typeName, fieldName string) bool {
+	if e == nil || e.fieldSelections == nil {
+		return true
+	}
+
+	selected, ok := e.fieldSelections[typeName]
+	if !ok {
+		return true
+	}
+
+	return selected[fieldName]
+}
+
+func (e *ApiExtras) includeAllowed(path string) bool {
+	if e == nil || !e.filterIncludes {
+		return true
+	}
+
+	return e.includePaths[path]
+}
+
+// MarshalOnePayload writes a JSON:API payload for a single resource,
+// including any relationships and sideloaded related resources declared
+// via jsonapi struct tags.
+func MarshalOnePayload(w io.Writer, model interface{}) error {
+	payload, err := marshalOne(model, nil)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(payload)
+}
+
+// MarshalOnePayloadWithExtras is identical to MarshalOnePayload, but also
+// applies top-level links, relationship links, sparse fieldsets and
+// include-path filtering supplied via the extras callback.
+func MarshalOnePayloadWithExtras(w io.Writer, model interface{}, extrasFn func(*ApiExtras)) error {
+	extras := newApiExtras()
+	if extrasFn != nil {
+		extrasFn(extras)
+	}
+
+	payload, err := marshalOne(model, extras)
+	if err != nil {
+		return err
+	}
+
+	applyExtras(payload.Data, payload.Included, extras)
+
+	if len(extras.rootLinks) > 0 {
+		payload.Links = extras.rootLinks
+	}
+
+	if len(extras.rootMeta) > 0 {
+		payload.Meta = extras.rootMeta
+	}
+
+	return json.NewEncoder(w).Encode(payload)
+}
+
+// MarshalManyPayload writes a JSON:API payload for a slice of resources.
+func MarshalManyPayload(w io.Writer, models []interface{}) error {
+	payload, err := marshalMany(models)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(payload)
+}
+
+func marshalOne(model interface{}, extras *ApiExtras) (*OnePayload, error) {
+	included := make(map[string]*Node)
+
+	rootNode, err := visitModelNode(model, &included, extras, "")
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &OnePayload{Data: rootNode}
+
+	if len(included) > 0 {
+		payload.Included = nodeMapValues(included)
+	}
+
+	return payload, nil
+}
+
+func marshalMany(models []interface{}) (*ManyPayload, error) {
+	included := make(map[string]*Node)
+
+	data := make([]*Node, 0, len(models))
+	for _, model := range models {
+		node, err := visitModelNode(model, &included, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, node)
+	}
+
+	payload := &ManyPayload{Data: data}
+
+	if len(included) > 0 {
+		payload.Included = nodeMapValues(included)
+	}
+
+	return payload, nil
+}
+
+func applyExtras(root *Node, included []*Node, extras *ApiExtras) {
+	if len(extras.relationshipLinks) == 0 {
+		return
+	}
+
+	nodes := append([]*Node{root}, included...)
+
+	for _, link := range extras.relationshipLinks {
+		for _, node := range nodes {
+			if node == nil || node.Type != link.ownerType {
+				continue
+			}
+
+			rel, ok := node.Relationships[link.relationName]
+			if !ok {
+				continue
+			}
+
+			relMap, ok := rel.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			links, ok := relMap["links"].(map[string]interface{})
+			if !ok {
+				links = map[string]interface{}{}
+				relMap["links"] = links
+			}
+
+			links[link.pageName] = renderRelationshipLink(link.url, node.Type, node.Id)
+		}
+	}
+}
+
+// renderRelationshipLink replaces every occurrence of the owning node's
+// "{type.id}" placeholder with its id (placeholders for other types are
+// left as they are), then percent-encodes everything after the first "?" as
+// an opaque blob so that templated ids can never smuggle extra query
+// parameters into the link.
+func renderRelationshipLink(rawURL, ownerType, ownerId string) string {
+	placeholder := "{" + ownerType + ".id}"
+	rawURL = strings.Replace(rawURL, placeholder, ownerId, -1)
+
+	if idx := strings.Index(rawURL, "?"); idx >= 0 {
+		return rawURL[:idx+1] + url.QueryEscape(rawURL[idx+1:])
+	}
+
+	return rawURL
+}
+
+func nodeMapValues(m map[string]*Node) []*Node {
+	nodes := make([]*Node, 0, len(m))
+	for _, n := range m {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func visitModelNode(model interface{}, included *map[string]*Node, extras *ApiExtras, path string) (*Node, error) {
+	node := new(Node)
+
+	// A Referencer's type/id take priority over the primary tag, and must
+	// be resolved before the field loop below so that fieldAllowed checks
+	// against node.Type see the real jsonapi type, not the zero value.
+	ref, isReferencer := model.(Referencer)
+	if isReferencer {
+		node.Type = ref.JSONAPIType()
+		node.Id = ref.JSONAPIID()
+	}
+
+	value := reflect.ValueOf(model)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	modelType := value.Type()
+
+	// node.Type must be known before the field loop below runs its
+	// fieldAllowed checks, so that a relation/attr field declared ahead of
+	// the primary field in the struct (legal Go; no field-order convention
+	// is enforced) still gets filtered correctly. Referencer models were
+	// already resolved above; plain models are resolved here by scanning
+	// ahead for the primary tag.
+	if !isReferencer {
+		for i := 0; i < modelType.NumField(); i++ {
+			tag := modelType.Field(i).Tag.Get("jsonapi")
+			if tag == "" {
+				continue
+			}
+
+			args := strings.Split(tag, ",")
+			if args[0] != annotationPrimary {
+				continue
+			}
+
+			if len(args) < 2 {
+				return nil, errors.New("jsonapi: primary tag, got two few arguments")
+			}
+
+			node.Type = args[1]
+
+			id, err := idToString(value.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Id = id
+
+			break
+		}
+	}
+
+	for i := 0; i < modelType.NumField(); i++ {
+		structField := modelType.Field(i)
+		tag := structField.Tag.Get("jsonapi")
+		if tag == "" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		args := strings.Split(tag, ",")
+		annotation := args[0]
+
+		switch annotation {
+		case annotationPrimary:
+			// Already resolved above (or skipped for Referencer models).
+			continue
+
+		case annotationAttr:
+			if len(args) < 2 {
+				return nil, errors.New("jsonapi: attr tag, got two few arguments")
+			}
+
+			if !extras.fieldAllowed(node.Type, args[1]) {
+				continue
+			}
+
+			if t, ok := fieldValue.Interface().(time.Time); ok {
+				if t.IsZero() {
+					continue
+				}
+				setAttr(node, args[1], t)
+				continue
+			}
+
+			setAttr(node, args[1], fieldValue.Interface())
+
+		case annotationRelation:
+			if len(args) < 2 {
+				return nil, errors.New("jsonapi: relation tag, got two few arguments")
+			}
+
+			if !extras.fieldAllowed(node.Type, args[1]) {
+				continue
+			}
+
+			childPath := args[1]
+			if path != "" {
+				childPath = path + "." + args[1]
+			}
+
+			if err := visitRelation(node, args[1], fieldValue, included, extras, childPath); err != nil {
+				return nil, err
+			}
+
+		case annotationLinks:
+			if len(args) < 2 {
+				return nil, errors.New("jsonapi: links tag, got two few arguments")
+			}
+
+			if args[1] != annotationTopLinks && !extras.fieldAllowed(node.Type, args[1]) {
+				continue
+			}
+
+			visitLinks(node, args[1], fieldValue)
+		}
+	}
+
+	return node, nil
+}
+
+func idToString(fieldValue reflect.Value) (string, error) {
+	switch fieldValue.Kind() {
+	case reflect.String:
+		return fieldValue.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fieldValue.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fieldValue.Uint(), 10), nil
+	default:
+		return "", errors.New("jsonapi: primary field must be a string or integer type")
+	}
+}
+
+func setAttr(node *Node, name string, value interface{}) {
+	if node.Attributes == nil {
+		node.Attributes = map[string]interface{}{}
+	}
+	node.Attributes[name] = value
+}
+
+func visitLinks(node *Node, name string, fieldValue reflect.Value) {
+	if fieldValue.Kind() != reflect.Map || fieldValue.IsNil() {
+		return
+	}
+
+	links := make(map[string]interface{}, fieldValue.Len())
+	for _, key := range fieldValue.MapKeys() {
+		links[key.String()] = fieldValue.MapIndex(key).Interface()
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	if name == annotationTopLinks {
+		node.Links = links
+		return
+	}
+
+	if node.Relationships == nil {
+		node.Relationships = map[string]interface{}{}
+	}
+
+	rel, ok := node.Relationships[name].(map[string]interface{})
+	if !ok {
+		rel = map[string]interface{}{}
+		node.Relationships[name] = rel
+	}
+	rel["links"] = links
+}
+
+func visitRelation(node *Node, name string, fieldValue reflect.Value, included *map[string]*Node, extras *ApiExtras, path string) error {
+	switch fieldValue.Kind() {
+	case reflect.Slice:
+		if fieldValue.IsNil() {
+			return nil
+		}
+
+		data := make([]interface{}, 0, fieldValue.Len())
+		for i := 0; i < fieldValue.Len(); i++ {
+			ref, err := addRelated(fieldValue.Index(i), included, extras, path)
+			if err != nil {
+				return err
+			}
+			if ref == nil {
+				continue
+			}
+			data = append(data, ref)
+		}
+
+		setRelationship(node, name, data)
+
+	case reflect.Ptr:
+		if fieldValue.IsNil() {
+			return nil
+		}
+
+		ref, err := addRelated(fieldValue, included, extras, path)
+		if err != nil {
+			return err
+		}
+
+		setRelationship(node, name, ref)
+
+	default:
+		return errors.New("jsonapi: relation field must be a pointer or slice of pointers")
+	}
+
+	return nil
+}
+
+func setRelationship(node *Node, name string, data interface{}) {
+	if node.Relationships == nil {
+		node.Relationships = map[string]interface{}{}
+	}
+
+	rel, ok := node.Relationships[name].(map[string]interface{})
+	if !ok {
+		rel = map[string]interface{}{}
+		node.Relationships[name] = rel
+	}
+	rel["data"] = data
+}
+
+// Referencer lets a related value override how it is identified in a
+// relationship's "data" block and in the top-level "included" array,
+// bypassing the primary struct tag lookup for that element. This is what
+// makes polymorphic relationships possible: a []interface{} relation field
+// whose elements are different concrete types can have each element
+// report its own jsonapi type and id instead of relying on a single
+// static Go field type.
+type Referencer interface {
+	JSONAPIType() string
+	JSONAPIID() string
+}
+
+// addRelated visits a single related model and returns the {type, id}
+// reference for use in a relationships data block. It is only sideloaded
+// into included when path is allowed by the extras' Include filter (or
+// when there is no such filter, the default).
+func addRelated(fieldValue reflect.Value, included *map[string]*Node, extras *ApiExtras, path string) (map[string]interface{}, error) {
+	// fieldValue.IsZero() covers both a nil *T (Kind() == Ptr) and a nil
+	// element of a polymorphic []interface{} relation, which reports
+	// Kind() == Interface rather than Ptr and so would not be caught by a
+	// Ptr-only nil check.
+	if fieldValue.IsZero() {
+		return nil, nil
+	}
+
+	model := fieldValue.Interface()
+
+	relatedNode, err := visitModelNode(model, included, extras, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if extras.includeAllowed(path) {
+		key := relatedNode.Type + "#" + relatedNode.Id
+		if _, ok := (*included)[key]; !ok {
+			(*included)[key] = relatedNode
+		}
+	}
+
+	return map[string]interface{}{
+		"type": relatedNode.Type,
+		"id":   relatedNode.Id,
+	}, nil
+}